@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
@@ -31,10 +32,45 @@ type KubeNodes struct {
 	ttl             uint32
 	ipType, dnsType core.NodeAddressType
 
+	// readyOnly excludes nodes whose Ready condition is not True. It also
+	// gates the includeUnschedulable check below: node filtering is entirely
+	// opt-in, so a Corefile without ready_only keeps publishing every node,
+	// cordoned or not, as it did before this filtering existed.
+	readyOnly bool
+	// includeUnschedulable, when false and readyOnly is set, also excludes
+	// cordoned (spec.unschedulable) nodes.
+	includeUnschedulable bool
+
+	// groups are label-selector-scoped views of the node list, each published
+	// under its own subzone of the primary zone.
+	groups []*nodeGroup
+
+	// transferACL lists the peers allowed to AXFR/IXFR the zone, configured
+	// with "transfer to ADDR...". A nil ACL refuses all transfers.
+	transferACL []*net.IPNet
+
+	// txtLabels and txtAnnotations are the allow-listed label/annotation keys
+	// published as TXT records, configured with "txt labels ... annotations ...".
+	txtLabels, txtAnnotations []string
+
+	// configMapNamespace/configMapName name the ConfigMap, if any, whose data
+	// holds static overlay records (configured with "configmap NAMESPACE/NAME").
+	configMapNamespace, configMapName string
+	overlayMu                         sync.RWMutex
+	// overlay maps a lowercased owner name to the zone-file-fragment records
+	// configured for it; these take precedence over node-derived records.
+	overlay map[string][]dns.RR
+
+	// serial is the zone's SOA serial. New seeds it from wall-clock time so
+	// it keeps increasing across restarts, and it is bumped on every
+	// informer add/update/delete.
+	serial uint32
+
 	// Kubernetes API interface
-	client     kubernetes.Interface
-	controller cache.Controller
-	indexer    cache.Indexer
+	client              kubernetes.Interface
+	controller          cache.Controller
+	indexer             cache.Indexer
+	configMapController cache.Controller
 
 	// concurrency control to stop controller
 	stopLock sync.Mutex
@@ -42,6 +78,17 @@ type KubeNodes struct {
 	stopCh   chan struct{}
 }
 
+// nodeGroup is a named, label-selector-scoped subset of the cluster's nodes,
+// published under zone (e.g. "workers.example.").
+type nodeGroup struct {
+	name     string
+	selector string
+	zone     string
+
+	controller cache.Controller
+	indexer    cache.Indexer
+}
+
 type upstreamer interface {
 	Lookup(ctx context.Context, state request.Request, name string, typ uint16) (*dns.Msg, error)
 }
@@ -55,6 +102,10 @@ func New(zones []string) *KubeNodes {
 	k.stopCh = make(chan struct{})
 	k.ipType = core.NodeInternalIP
 	k.dnsType = core.NodeInternalDNS
+	// Seed the serial from wall-clock time so it increases monotonically
+	// across restarts; AXFR/IXFR secondaries compare serials numerically and
+	// would otherwise see a fresh process's zero-valued serial as stale.
+	k.serial = uint32(time.Now().Unix())
 	return k
 }
 
@@ -64,22 +115,34 @@ const (
 )
 
 // Name implements the Handler interface.
-func (k KubeNodes) Name() string { return "kubenodes" }
+func (k *KubeNodes) Name() string { return "kubenodes" }
 
 // ServeDNS implements the plugin.Handler interface.
-func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+func (k *KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 	state := request.Request{W: w, Req: r}
 
 	qname := state.Name()
 	zone := plugin.Zones(k.Zones).Matches(qname)
-	if zone == "" || !supportedQtype(state.QType()) {
+	if zone == "" {
 		return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
 	}
 	zone = state.QName()[len(qname)-len(zone):] // maintain case of original query
 	state.Zone = zone
 
+	if state.QType() == dns.TypeAXFR || state.QType() == dns.TypeIXFR {
+		return k.serveXfr(w, r, state, zone)
+	}
+
+	if !supportedQtype(state.QType()) {
+		return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
+	}
+
+	if rrs, ok := k.overlayLookup(qname); ok {
+		return k.serveOverlay(state, w, r, rrs)
+	}
+
 	if len(zone) == len(qname) {
-		writeResponse(w, r, nil, nil, []dns.RR{k.soa()}, dns.RcodeSuccess)
+		writeResponse(state, w, r, nil, nil, []dns.RR{k.soa(zone)}, dns.RcodeSuccess)
 		return dns.RcodeSuccess, nil
 	}
 
@@ -94,7 +157,7 @@ func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 				if k.Fall.Through(state.Name()) {
 					return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
 				}
-				writeResponse(w, r, nil, nil, []dns.RR{k.soa()}, dns.RcodeNameError)
+				writeResponse(state, w, r, nil, nil, []dns.RR{k.soa(zone)}, dns.RcodeNameError)
 				return dns.RcodeNameError, nil
 			}
 			var records []dns.RR
@@ -108,7 +171,7 @@ func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 					Ptr: dnsutil.Join(node.Name, k.Zones[0]),
 				})
 			}
-			writeResponse(w, r, records, nil, nil, dns.RcodeSuccess)
+			writeResponse(state, w, r, records, nil, nil, dns.RcodeSuccess)
 			return dns.RcodeSuccess, nil
 		}
 	}
@@ -118,8 +181,15 @@ func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		nodeName = state.Name()[0 : len(qname)-len(zone)]
 	}
 
+	// a query for a group's subzone is served from that group's own
+	// label-selector-scoped indexer instead of the full node list
+	indexer := k.indexer
+	if g := k.groupForZone(zone); g != nil {
+		indexer = g.indexer
+	}
+
 	// get the node by key name from the indexer
-	item, exists, err := k.indexer.GetByKey(nodeName)
+	item, exists, err := indexer.GetByKey(nodeName)
 	if err != nil {
 		return dns.RcodeServerFailure, err
 	}
@@ -128,7 +198,7 @@ func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		if k.Fall.Through(state.Name()) {
 			return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
 		}
-		writeResponse(w, r, nil, nil, []dns.RR{k.soa()}, dns.RcodeNameError)
+		writeResponse(state, w, r, nil, nil, []dns.RR{k.soa(zone)}, dns.RcodeNameError)
 		return dns.RcodeNameError, nil
 	}
 
@@ -137,6 +207,19 @@ func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		return dns.RcodeServerFailure, fmt.Errorf("unexpected %q from *Node index", reflect.TypeOf(item))
 	}
 
+	if !k.nodeUsable(node) {
+		if k.Fall.Through(state.Name()) {
+			return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
+		}
+		writeResponse(state, w, r, nil, nil, []dns.RR{k.soa(zone)}, dns.RcodeNameError)
+		return dns.RcodeNameError, nil
+	}
+
+	if state.QType() == dns.TypeTXT {
+		writeResponse(state, w, r, k.txtRecords(node, qname), nil, nil, dns.RcodeSuccess)
+		return dns.RcodeSuccess, nil
+	}
+
 	// extract IPs from the node
 	var ips []string
 	for _, addr := range node.Status.Addresses {
@@ -148,8 +231,10 @@ func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 			// it's name. So look up the IP address and append them to ips
 			m, err := k.Upstream.Lookup(ctx, state, addr.Address, state.QType())
 			if err != nil {
+				upstreamLookupCount.WithLabelValues("error").Inc()
 				return dns.RcodeServerFailure, err
 			}
+			upstreamLookupCount.WithLabelValues(dns.RcodeToString[m.Rcode]).Inc()
 			for _, a := range m.Answer {
 				switch a.Header().Rrtype {
 				case dns.TypeA:
@@ -186,11 +271,13 @@ func (k KubeNodes) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		}
 	}
 
-	writeResponse(w, r, records, nil, nil, dns.RcodeSuccess)
+	writeResponse(state, w, r, records, nil, nil, dns.RcodeSuccess)
 	return dns.RcodeSuccess, nil
 }
 
-func writeResponse(w dns.ResponseWriter, r *dns.Msg, answer, extra, ns []dns.RR, rcode int) {
+func writeResponse(state request.Request, w dns.ResponseWriter, r *dns.Msg, answer, extra, ns []dns.RR, rcode int) {
+	requestCount.WithLabelValues(state.Zone, state.Type(), dns.RcodeToString[rcode]).Inc()
+
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Rcode = rcode
@@ -201,12 +288,14 @@ func writeResponse(w dns.ResponseWriter, r *dns.Msg, answer, extra, ns []dns.RR,
 	w.WriteMsg(m)
 }
 
-func (k KubeNodes) soa() *dns.SOA {
+// soa returns the SOA record for zone, the zone actually being answered
+// (which may be a group subzone or a reverse zone, not just k.Zones[0]).
+func (k *KubeNodes) soa(zone string) *dns.SOA {
 	return &dns.SOA{
-		Hdr:     dns.RR_Header{Name: k.Zones[0], Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: k.ttl},
-		Ns:      dnsutil.Join("ns.dns", k.Zones[0]),
-		Mbox:    dnsutil.Join("hostmaster.dns", k.Zones[0]),
-		Serial:  uint32(time.Now().Unix()),
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: k.ttl},
+		Ns:      dnsutil.Join("ns.dns", zone),
+		Mbox:    dnsutil.Join("hostmaster.dns", zone),
+		Serial:  atomic.LoadUint32(&k.serial),
 		Refresh: 7200,
 		Retry:   1800,
 		Expire:  86400,
@@ -214,14 +303,277 @@ func (k KubeNodes) soa() *dns.SOA {
 	}
 }
 
+// xfrChunkSize caps how many records are sent per AXFR/IXFR envelope.
+const xfrChunkSize = 500
+
+// serveXfr handles AXFR and, with a fallback to a full zone transfer, IXFR
+// requests for zone, subject to transferACL.
+func (k *KubeNodes) serveXfr(w dns.ResponseWriter, r *dns.Msg, state request.Request, zone string) (int, error) {
+	if !k.transferAllowed(state) {
+		requestCount.WithLabelValues(state.Zone, state.Type(), dns.RcodeToString[dns.RcodeRefused]).Inc()
+		return dns.RcodeRefused, nil
+	}
+
+	soa := k.soa(zone)
+	if state.QType() == dns.TypeIXFR {
+		if ixfrSoa, ok := ixfrRequestSOA(r); ok && ixfrSoa.Serial == soa.Serial {
+			requestCount.WithLabelValues(state.Zone, state.Type(), dns.RcodeToString[dns.RcodeSuccess]).Inc()
+			return k.sendXfrEnvelopes(w, r, []dns.RR{soa})
+		}
+	}
+
+	records := []dns.RR{soa}
+	if g := k.groupForZone(zone); g != nil {
+		records = append(records, k.xfrForwardRecords(g.indexer, zone)...)
+		records = append(records, k.xfrOverlayRecords(zone)...)
+	} else if zone == k.Zones[0] {
+		records = append(records, k.xfrForwardRecords(k.indexer, zone)...)
+		records = append(records, k.xfrOverlayRecords(zone)...)
+	} else {
+		records = append(records, k.xfrReverseRecords()...)
+	}
+	records = append(records, soa)
+
+	requestCount.WithLabelValues(state.Zone, state.Type(), dns.RcodeToString[dns.RcodeSuccess]).Inc()
+	return k.sendXfrEnvelopes(w, r, records)
+}
+
+// ixfrRequestSOA extracts the client's current SOA serial from an IXFR query.
+func ixfrRequestSOA(r *dns.Msg) (*dns.SOA, bool) {
+	if len(r.Ns) == 0 {
+		return nil, false
+	}
+	soa, ok := r.Ns[0].(*dns.SOA)
+	return soa, ok
+}
+
+// xfrForwardRecords returns one A/AAAA record per usable node address in indexer.
+func (k *KubeNodes) xfrForwardRecords(indexer cache.Indexer, zone string) []dns.RR {
+	var records []dns.RR
+	for _, obj := range indexer.List() {
+		node, ok := obj.(*core.Node)
+		if !ok || !k.nodeUsable(node) {
+			continue
+		}
+		name := dnsutil.Join(node.Name, zone)
+		for _, addr := range node.Status.Addresses {
+			if addr.Type != k.ipType {
+				continue
+			}
+			ip := net.ParseIP(addr.Address)
+			switch {
+			case ip == nil:
+				continue
+			case ip.To4() != nil:
+				records = append(records, &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: k.ttl}, A: ip})
+			default:
+				records = append(records, &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: k.ttl}, AAAA: ip})
+			}
+		}
+	}
+	return records
+}
+
+// xfrReverseRecords returns one PTR record per usable node address in the
+// default (ungrouped) node list.
+func (k *KubeNodes) xfrReverseRecords() []dns.RR {
+	var records []dns.RR
+	for _, obj := range k.indexer.List() {
+		node, ok := obj.(*core.Node)
+		if !ok || !k.nodeUsable(node) {
+			continue
+		}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type != k.ipType {
+				continue
+			}
+			rev, err := dns.ReverseAddr(addr.Address)
+			if err != nil {
+				continue
+			}
+			records = append(records, &dns.PTR{
+				Hdr: dns.RR_Header{Name: rev, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: k.ttl},
+				Ptr: dnsutil.Join(node.Name, k.Zones[0]),
+			})
+		}
+	}
+	return records
+}
+
+// xfrOverlayRecords returns the static ConfigMap-sourced overlay records
+// owned within zone, so a zone transfer stays consistent with what
+// serveOverlay already answers for the same names one query at a time.
+func (k *KubeNodes) xfrOverlayRecords(zone string) []dns.RR {
+	k.overlayMu.RLock()
+	defer k.overlayMu.RUnlock()
+	var records []dns.RR
+	for name, rrs := range k.overlay {
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		records = append(records, rrs...)
+	}
+	return records
+}
+
+// sendXfrEnvelopes streams records to w in xfrChunkSize-sized envelopes, following
+// the dns.Transfer/t.Out pattern.
+func (k *KubeNodes) sendXfrEnvelopes(w dns.ResponseWriter, r *dns.Msg, records []dns.RR) (int, error) {
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+	errCh := make(chan error, 1)
+	go func() { errCh <- tr.Out(w, r, ch) }()
+
+	for len(records) > 0 {
+		n := xfrChunkSize
+		if n > len(records) {
+			n = len(records)
+		}
+		ch <- &dns.Envelope{RR: records[:n]}
+		records = records[n:]
+	}
+	close(ch)
+	if err := <-errCh; err != nil {
+		return dns.RcodeServerFailure, err
+	}
+
+	w.Hijack()
+	return dns.RcodeSuccess, nil
+}
+
+// transferAllowed reports whether state's peer is permitted to transfer the
+// zone, per the configured "transfer to ADDR..." ACL. With no ACL configured,
+// all transfers are refused.
+func (k *KubeNodes) transferAllowed(state request.Request) bool {
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return false
+	}
+	for _, n := range k.transferACL {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayLookup returns the static overlay records configured for name, if any.
+func (k *KubeNodes) overlayLookup(name string) ([]dns.RR, bool) {
+	k.overlayMu.RLock()
+	defer k.overlayMu.RUnlock()
+	rrs, ok := k.overlay[strings.ToLower(name)]
+	return rrs, ok
+}
+
+// setOverlay atomically replaces the overlay record set.
+func (k *KubeNodes) setOverlay(overlay map[string][]dns.RR) {
+	k.overlayMu.Lock()
+	k.overlay = overlay
+	k.overlayMu.Unlock()
+}
+
+// serveOverlay answers a query from a name's static overlay records. A CNAME
+// is preferred when present, regardless of qtype, matching how CNAMEs are
+// normally resolved; otherwise only records matching qtype are returned.
+func (k *KubeNodes) serveOverlay(state request.Request, w dns.ResponseWriter, r *dns.Msg, rrs []dns.RR) (int, error) {
+	var answer []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeCNAME {
+			answer = append(answer, rr)
+		}
+	}
+	if len(answer) == 0 {
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == state.QType() {
+				answer = append(answer, rr)
+			}
+		}
+	}
+	writeResponse(state, w, r, answer, nil, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, nil
+}
+
+// groupForZone returns the node group published under zone, or nil if zone
+// belongs to the default (ungrouped) node list.
+func (k *KubeNodes) groupForZone(zone string) *nodeGroup {
+	for _, g := range k.groups {
+		if g.zone == zone {
+			return g
+		}
+	}
+	return nil
+}
+
+// nodeUsable reports whether node should be published in DNS answers, given
+// the readyOnly and includeUnschedulable settings. Both filters are opt-in
+// behind readyOnly: without it, upgrading to a version that understands
+// spec.unschedulable must not silently start excluding cordoned nodes that a
+// Corefile with no new directives was already publishing.
+func (k *KubeNodes) nodeUsable(node *core.Node) bool {
+	if !k.readyOnly {
+		return true
+	}
+	if !nodeReady(node) {
+		return false
+	}
+	if !k.includeUnschedulable && node.Spec.Unschedulable {
+		return false
+	}
+	return true
+}
+
+// nodeReady reports whether node's Ready condition is True.
+func nodeReady(node *core.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == core.NodeReady {
+			return cond.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
+
 func supportedQtype(qtype uint16) bool {
 	switch qtype {
-	case dns.TypeA, dns.TypeAAAA, dns.TypePTR:
+	case dns.TypeA, dns.TypeAAAA, dns.TypePTR, dns.TypeTXT:
 		return true
 	default:
 		return false
 	}
 }
 
+// txtRecords publishes node's configured labels and annotations as one TXT
+// record per key, in "key=value" form.
+func (k *KubeNodes) txtRecords(node *core.Node, qname string) []dns.RR {
+	var records []dns.RR
+	for _, key := range k.txtLabels {
+		if v, ok := node.Labels[key]; ok {
+			records = append(records, newTxtRecord(qname, k.ttl, key, v))
+		}
+	}
+	for _, key := range k.txtAnnotations {
+		if v, ok := node.Annotations[key]; ok {
+			records = append(records, newTxtRecord(qname, k.ttl, key, v))
+		}
+	}
+	return records
+}
+
+func newTxtRecord(qname string, ttl uint32, key, value string) *dns.TXT {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl},
+		Txt: []string{fmt.Sprintf("%s=%s", key, value)},
+	}
+}
+
 // Ready implements the ready.Readiness interface.
-func (k *KubeNodes) Ready() bool { return k.controller.HasSynced() }
+func (k *KubeNodes) Ready() bool {
+	if !k.controller.HasSynced() {
+		return false
+	}
+	for _, g := range k.groups {
+		if !g.controller.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
@@ -44,12 +44,12 @@ func TestServeDNSInternal(t *testing.T) {
 		{
 			Qname: "example.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("example.")},
 		},
 		{
 			Qname: "nonexistent-node.example.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("example.")},
 		},
 	}
 
@@ -124,12 +124,12 @@ func TestServeDNSExternal(t *testing.T) {
 		{
 			Qname: "example.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("example.")},
 		},
 		{
 			Qname: "nonexistent-node.example.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("example.")},
 		},
 	}
 
@@ -235,6 +235,456 @@ func TestServeDNSUpstream(t *testing.T) {
 	runTests(t, ctx, k, externalCases)
 }
 
+func TestServeDNSGroup(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	workers := &nodeGroup{name: "workers", selector: "role=worker", zone: "workers.example."}
+	k.groups = []*nodeGroup{workers}
+	k.Zones = append(k.Zones, workers.zone)
+
+	var groupCases = []test.Case{
+		{
+			Qname: "node1.workers.example.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("node1.workers.example.	5	IN	A	1.2.3.4"),
+			},
+		},
+		{
+			Qname: "node2.workers.example.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("workers.example.")},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	node1 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{
+			Name:   "node1",
+			Labels: map[string]string{"role": "worker"},
+		},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalIP, Address: "1.2.3.4"},
+			},
+		},
+	}
+	node2 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "node2",
+		},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalIP, Address: "1.2.3.5"},
+			},
+		},
+	}
+	k.client.CoreV1().Nodes().Create(ctx, node1, meta.CreateOptions{})
+	k.client.CoreV1().Nodes().Create(ctx, node2, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	go workers.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.Ready() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, groupCases)
+}
+
+func TestServeDNSReadyOnly(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	k.readyOnly = true
+
+	var readyCases = []test.Case{
+		{
+			Qname: "node1.example.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("node1.example.	5	IN	A	1.2.3.4"),
+			},
+		},
+		{
+			Qname: "node2.example.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("example.")},
+		},
+		{
+			Qname: "node3.example.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("example.")},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	node1 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node1"},
+		Status: core.NodeStatus{
+			Addresses:  []core.NodeAddress{{Type: core.NodeInternalIP, Address: "1.2.3.4"}},
+			Conditions: []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionTrue}},
+		},
+	}
+	node2 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node2"},
+		Status: core.NodeStatus{
+			Addresses:  []core.NodeAddress{{Type: core.NodeInternalIP, Address: "1.2.3.5"}},
+			Conditions: []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionFalse}},
+		},
+	}
+	// node3 is Ready but cordoned: with readyOnly set and includeUnschedulable
+	// left at its default (false), it must still be excluded.
+	node3 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node3"},
+		Spec:       core.NodeSpec{Unschedulable: true},
+		Status: core.NodeStatus{
+			Addresses:  []core.NodeAddress{{Type: core.NodeInternalIP, Address: "1.2.3.6"}},
+			Conditions: []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionTrue}},
+		},
+	}
+	k.client.CoreV1().Nodes().Create(ctx, node1, meta.CreateOptions{})
+	k.client.CoreV1().Nodes().Create(ctx, node2, meta.CreateOptions{})
+	k.client.CoreV1().Nodes().Create(ctx, node3, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, readyCases)
+}
+
+// TestServeDNSUnschedulableDefault confirms that without ready_only, a
+// Corefile with zero new directives keeps publishing cordoned nodes exactly
+// as it did before spec.unschedulable filtering existed.
+func TestServeDNSUnschedulableDefault(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+
+	var cases = []test.Case{
+		{
+			Qname: "node1.example.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("node1.example.	5	IN	A	1.2.3.4"),
+			},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	node1 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node1"},
+		Spec:       core.NodeSpec{Unschedulable: true},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{{Type: core.NodeInternalIP, Address: "1.2.3.4"}},
+		},
+	}
+	k.client.CoreV1().Nodes().Create(ctx, node1, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, cases)
+}
+
+func TestServeDNSAxfrRefused(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	r := new(dns.Msg)
+	r.SetAxfr("example.")
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	rcode, err := k.ServeDNS(ctx, w, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rcode != dns.RcodeRefused {
+		t.Errorf("expected RcodeRefused with no transfer ACL, got %d", rcode)
+	}
+}
+
+// TestServeDNSAxfrSuccess exercises a full AXFR from an authorized peer,
+// checking the envelope opens and closes with the zone's SOA and carries the
+// node's A record in between.
+func TestServeDNSAxfrSuccess(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	peer, err := parseTransferPeer("10.240.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k.transferACL = []*net.IPNet{peer}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	node1 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node1"},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{{Type: core.NodeInternalIP, Address: "1.2.3.4"}},
+		},
+	}
+	k.client.CoreV1().Nodes().Create(ctx, node1, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	r := new(dns.Msg)
+	r.SetAxfr("example.")
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	rcode, err := k.ServeDNS(ctx, w, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Fatalf("expected RcodeSuccess from an authorized peer, got %d", rcode)
+	}
+
+	if w.Msg == nil || len(w.Msg.Answer) == 0 {
+		t.Fatal("expected a non-empty envelope")
+	}
+	if _, ok := w.Msg.Answer[0].(*dns.SOA); !ok {
+		t.Errorf("expected envelope to open with the zone's SOA, got %T", w.Msg.Answer[0])
+	}
+	if _, ok := w.Msg.Answer[len(w.Msg.Answer)-1].(*dns.SOA); !ok {
+		t.Errorf("expected envelope to close with the zone's SOA, got %T", w.Msg.Answer[len(w.Msg.Answer)-1])
+	}
+	var sawA bool
+	for _, rr := range w.Msg.Answer {
+		if a, ok := rr.(*dns.A); ok && a.Hdr.Name == "node1.example." && a.A.String() == "1.2.3.4" {
+			sawA = true
+		}
+	}
+	if !sawA {
+		t.Error("expected envelope to contain node1's A record")
+	}
+}
+
+// TestServeDNSIxfrSameSerial checks the IXFR shortcut: when the requesting
+// peer's serial already matches the zone's current serial, the reply is a
+// single-SOA envelope rather than a full zone re-transfer.
+func TestServeDNSIxfrSameSerial(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	peer, err := parseTransferPeer("10.240.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k.transferACL = []*net.IPNet{peer}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	soa := k.soa("example.")
+	r := new(dns.Msg)
+	r.SetIxfr("example.", soa.Serial, soa.Ns, soa.Mbox)
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	rcode, err := k.ServeDNS(ctx, w, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Fatalf("expected RcodeSuccess, got %d", rcode)
+	}
+	if len(w.Msg.Answer) != 1 {
+		t.Fatalf("expected a single-SOA envelope for a same-serial IXFR, got %d records", len(w.Msg.Answer))
+	}
+	if _, ok := w.Msg.Answer[0].(*dns.SOA); !ok {
+		t.Errorf("expected the single record to be the SOA, got %T", w.Msg.Answer[0])
+	}
+}
+
+// TestServeDNSAxfrOverlay checks that ConfigMap-sourced overlay records are
+// included in a zone transfer, not just in answers to individual queries.
+func TestServeDNSAxfrOverlay(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	peer, err := parseTransferPeer("10.240.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	k.transferACL = []*net.IPNet{peer}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	k.onConfigMapChange(&core.ConfigMap{
+		Data: map[string]string{
+			"bastion.zone": "bastion.example. 5 IN A 10.0.0.9\n",
+		},
+	})
+
+	r := new(dns.Msg)
+	r.SetAxfr("example.")
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	rcode, err := k.ServeDNS(ctx, w, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Fatalf("expected RcodeSuccess, got %d", rcode)
+	}
+
+	var sawOverlay bool
+	for _, rr := range w.Msg.Answer {
+		if a, ok := rr.(*dns.A); ok && a.Hdr.Name == "bastion.example." && a.A.String() == "10.0.0.9" {
+			sawOverlay = true
+		}
+	}
+	if !sawOverlay {
+		t.Error("expected envelope to contain the ConfigMap overlay's bastion.example. A record")
+	}
+}
+
+func TestServeDNSOverlay(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	k.onConfigMapChange(&core.ConfigMap{
+		Data: map[string]string{
+			"bastion.zone": "bastion.example. 5 IN A 10.0.0.9\n",
+		},
+	})
+
+	var overlayCases = []test.Case{
+		{
+			Qname: "bastion.example.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("bastion.example.	5	IN	A	10.0.0.9"),
+			},
+		},
+	}
+
+	runTests(t, ctx, k, overlayCases)
+}
+
+// TestServeDNSOverlayUnsupportedQtype checks that an overlay-owned name still
+// falls through for qtypes this plugin doesn't model (MX, SOA, ANY, ...),
+// exactly like a non-overlay name would, instead of being swallowed by
+// serveOverlay into an empty NOERROR.
+func TestServeDNSOverlayUnsupportedQtype(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	k.onConfigMapChange(&core.ConfigMap{
+		Data: map[string]string{
+			"bastion.zone": "bastion.example. 5 IN A 10.0.0.9\n",
+		},
+	})
+
+	r := new(dns.Msg)
+	r.SetQuestion("bastion.example.", dns.TypeMX)
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	// No Next is configured, so falling through surfaces as a failure to
+	// find a next plugin rather than an empty NOERROR from serveOverlay.
+	rcode, err := k.ServeDNS(ctx, w, r)
+	if err == nil {
+		t.Fatal("expected an error falling through with no next plugin configured")
+	}
+	if rcode != dns.RcodeServerFailure {
+		t.Errorf("expected RcodeServerFailure falling through, got %d", rcode)
+	}
+}
+
+func TestServeDNSTxt(t *testing.T) {
+	k := New([]string{"example.", "in-addr.arpa.", "ip6.arpa."})
+	k.txtLabels = []string{"topology.kubernetes.io/zone"}
+	k.txtAnnotations = []string{"foo.io/bar"}
+
+	var txtCases = []test.Case{
+		{
+			Qname: "node1.example.", Qtype: dns.TypeTXT,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.TXT("node1.example.	5	IN	TXT	topology.kubernetes.io/zone=us-east-1a"),
+				test.TXT("node1.example.	5	IN	TXT	foo.io/bar=baz"),
+			},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	node1 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{
+			Name:        "node1",
+			Labels:      map[string]string{"topology.kubernetes.io/zone": "us-east-1a"},
+			Annotations: map[string]string{"foo.io/bar": "baz"},
+		},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalIP, Address: "1.2.3.4"},
+			},
+		},
+	}
+	k.client.CoreV1().Nodes().Create(ctx, node1, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, txtCases)
+}
+
 func runTests(t *testing.T, ctx context.Context, k *KubeNodes, cases []test.Case) {
 	for i, tc := range cases {
 		r := tc.Msg()
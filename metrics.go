@@ -0,0 +1,54 @@
+package kubenodes
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	dnsmetrics "github.com/coredns/coredns/plugin/metrics"
+)
+
+// Metrics exported by this plugin, following the pattern used by the cache
+// plugin's cacheHitCount/cacheMissCount.
+var (
+	nodeCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "node_count",
+		Help:      "Number of nodes currently indexed, per zone.",
+	}, []string{"zone"})
+
+	requestCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "dns_requests_total",
+		Help:      "Counter of DNS requests served by this plugin.",
+	}, []string{"zone", "qtype", "rcode"})
+
+	upstreamLookupCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "upstream_lookups_total",
+		Help:      "Counter of upstream lookups for NodeInternalDNS/NodeExternalDNS addresses.",
+	}, []string{"result"})
+
+	informerSyncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "informer_sync_duration_seconds",
+		Help:      "Histogram of time spent waiting for the node informer to sync.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+var metricsOnce sync.Once
+
+// registerMetrics registers this plugin's collectors with the metrics
+// plugin's registry, once per process.
+func registerMetrics(c *caddy.Controller) {
+	metricsOnce.Do(func() {
+		dnsmetrics.MustRegister(c, nodeCount, requestCount, upstreamLookupCount, informerSyncDuration)
+	})
+}
@@ -0,0 +1,157 @@
+package kubenodes
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+)
+
+func TestMetricsNodeCount(t *testing.T) {
+	k := New([]string{"example."})
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	node1 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node1"},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{{Type: core.NodeInternalIP, Address: "1.2.3.4"}},
+		},
+	}
+	k.client.CoreV1().Nodes().Create(ctx, node1, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if got, want := testutil.ToFloat64(nodeCount.WithLabelValues("example.")), 1.0; got != want {
+		t.Errorf("nodeCount(%q) = %v, want %v", "example.", got, want)
+	}
+}
+
+func TestMetricsRequestCount(t *testing.T) {
+	k := New([]string{"example."})
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	before := testutil.ToFloat64(requestCount.WithLabelValues("example.", "A", dns.RcodeToString[dns.RcodeNameError]))
+
+	r := new(dns.Msg)
+	r.SetQuestion("nonexistent-node.example.", dns.TypeA)
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := k.ServeDNS(ctx, w, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	after := testutil.ToFloat64(requestCount.WithLabelValues("example.", "A", dns.RcodeToString[dns.RcodeNameError]))
+	if after != before+1 {
+		t.Errorf("requestCount did not increment: before=%v after=%v", before, after)
+	}
+}
+
+func TestMetricsUpstreamLookupCount(t *testing.T) {
+	k := New([]string{"example."})
+	k.Upstream = newTestUpstream("testup", net.ParseIP("4.3.2.1"))
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	node1 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node1"},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalIP, Address: "1.2.3.4"},
+				{Type: core.NodeInternalDNS, Address: "testup"},
+			},
+		},
+	}
+	node2 := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node2"},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalIP, Address: "1.2.3.4"},
+				{Type: core.NodeInternalDNS, Address: "unresolvable"},
+			},
+		},
+	}
+	k.client.CoreV1().Nodes().Create(ctx, node1, meta.CreateOptions{})
+	k.client.CoreV1().Nodes().Create(ctx, node2, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	okBefore := testutil.ToFloat64(upstreamLookupCount.WithLabelValues(dns.RcodeToString[dns.RcodeSuccess]))
+	errBefore := testutil.ToFloat64(upstreamLookupCount.WithLabelValues(dns.RcodeToString[dns.RcodeNameError]))
+
+	for _, qname := range []string{"node1.example.", "node2.example."} {
+		r := new(dns.Msg)
+		r.SetQuestion(qname, dns.TypeA)
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := k.ServeDNS(ctx, w, r); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got, want := testutil.ToFloat64(upstreamLookupCount.WithLabelValues(dns.RcodeToString[dns.RcodeSuccess])), okBefore+1; got != want {
+		t.Errorf("upstreamLookupCount(NOERROR) = %v, want %v", got, want)
+	}
+	if got, want := testutil.ToFloat64(upstreamLookupCount.WithLabelValues(dns.RcodeToString[dns.RcodeNameError])), errBefore+1; got != want {
+		t.Errorf("upstreamLookupCount(NXDOMAIN) = %v, want %v", got, want)
+	}
+}
+
+func TestMetricsInformerSyncDuration(t *testing.T) {
+	k := New([]string{"example."})
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// sampleCount reads the histogram's observation count; CollectAndCount
+	// would only count the single collected metric.
+	sampleCount := func() uint64 {
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(informerSyncDuration)
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return mfs[0].GetMetric()[0].GetHistogram().GetSampleCount()
+	}
+
+	before := sampleCount()
+
+	start := time.Now()
+	cache.WaitForCacheSync(k.stopCh, k.controller.HasSynced)
+	informerSyncDuration.Observe(time.Since(start).Seconds())
+
+	if got, want := sampleCount(), before+1; got != want {
+		t.Errorf("informerSyncDuration observation count = %d, want %d", got, want)
+	}
+}
@@ -4,9 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/miekg/dns"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
@@ -14,6 +20,7 @@ import (
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/kubeapi"
 
@@ -32,6 +39,8 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error(pluginName, err)
 	}
 
+	registerMetrics(c)
+
 	k.setWatch(context.Background())
 	c.OnStartup(startWatch(k, dnsserver.GetConfig(c)))
 	c.OnShutdown(stopWatch(k))
@@ -89,6 +98,62 @@ func parseStanza(c *caddy.Controller) (*KubeNodes, error) {
 				return nil, c.Errf("ttl must be in range [0, 3600]: %d", t)
 			}
 			kns.ttl = uint32(t)
+		case "ready_only":
+			kns.readyOnly = true
+		case "include_unschedulable":
+			kns.includeUnschedulable = true
+		case "group":
+			args := c.RemainingArgs()
+			if len(args) != 3 || args[1] != "label" {
+				return nil, c.ArgErr()
+			}
+			name, selector := args[0], args[2]
+			zone := dnsutil.Join(name, kns.Zones[0])
+			kns.groups = append(kns.groups, &nodeGroup{name: name, selector: selector, zone: zone})
+			kns.Zones = append(kns.Zones, zone)
+		case "transfer":
+			args := c.RemainingArgs()
+			if len(args) < 2 || args[0] != "to" {
+				return nil, c.ArgErr()
+			}
+			for _, addr := range args[1:] {
+				n, err := parseTransferPeer(addr)
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				kns.transferACL = append(kns.transferACL, n)
+			}
+		case "txt":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			section := ""
+			for _, arg := range args {
+				switch arg {
+				case "labels", "annotations":
+					section = arg
+				default:
+					switch section {
+					case "labels":
+						kns.txtLabels = append(kns.txtLabels, arg)
+					case "annotations":
+						kns.txtAnnotations = append(kns.txtAnnotations, arg)
+					default:
+						return nil, c.Errf("txt keys must follow a 'labels' or 'annotations' section: %q", arg)
+					}
+				}
+			}
+		case "configmap":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			ns, name, found := strings.Cut(args[0], "/")
+			if !found || ns == "" || name == "" {
+				return nil, c.Errf("configmap must be of the form NAMESPACE/NAME: %q", args[0])
+			}
+			kns.configMapNamespace, kns.configMapName = ns, name
 		default:
 			return nil, c.Errf("unknown property '%s'", c.Val())
 		}
@@ -97,6 +162,30 @@ func parseStanza(c *caddy.Controller) (*KubeNodes, error) {
 	return kns, nil
 }
 
+// onNodeChange bumps the zone's SOA serial and refreshes its node_count gauge
+// in response to an informer add/update/delete event.
+func (k *KubeNodes) onNodeChange(zone string, indexer cache.Indexer) {
+	atomic.AddUint32(&k.serial, 1)
+	nodeCount.WithLabelValues(zone).Set(float64(len(indexer.List())))
+}
+
+// parseTransferPeer parses a "transfer to" address, which may be a bare IP
+// or a CIDR, into the *net.IPNet it matches against.
+func parseTransferPeer(addr string) (*net.IPNet, error) {
+	if _, ipnet, err := net.ParseCIDR(addr); err == nil {
+		return ipnet, nil
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid transfer peer %q", addr)
+	}
+	bits := 32
+	if ip.To4() == nil {
+		bits = 128
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
 func (k *KubeNodes) setWatch(ctx context.Context) {
 	// define Node controller and reverse lookup indexer
 	k.indexer, k.controller = cache.NewIndexerInformer(
@@ -110,12 +199,19 @@ func (k *KubeNodes) setWatch(ctx context.Context) {
 		},
 		&core.Node{},
 		0,
-		cache.ResourceEventHandlerFuncs{},
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { k.onNodeChange(k.Zones[0], k.indexer) },
+			UpdateFunc: func(oldObj, newObj interface{}) { k.onNodeChange(k.Zones[0], k.indexer) },
+			DeleteFunc: func(obj interface{}) { k.onNodeChange(k.Zones[0], k.indexer) },
+		},
 		cache.Indexers{"reverse": func(obj interface{}) ([]string, error) {
 			node, ok := obj.(*core.Node)
 			if !ok {
 				return nil, errors.New("unexpected obj type")
 			}
+			if !k.nodeUsable(node) {
+				return nil, nil
+			}
 			var idx []string
 			for _, addr := range node.Status.Addresses {
 				if addr.Type != k.ipType {
@@ -126,6 +222,84 @@ func (k *KubeNodes) setWatch(ctx context.Context) {
 			return idx, nil
 		}},
 	)
+
+	for _, g := range k.groups {
+		g := g
+		g.indexer, g.controller = cache.NewIndexerInformer(
+			&cache.ListWatch{
+				ListFunc: func(o v1.ListOptions) (runtime.Object, error) {
+					o.LabelSelector = g.selector
+					return k.client.CoreV1().Nodes().List(ctx, o)
+				},
+				WatchFunc: func(o v1.ListOptions) (watch.Interface, error) {
+					o.LabelSelector = g.selector
+					return k.client.CoreV1().Nodes().Watch(ctx, o)
+				},
+			},
+			&core.Node{},
+			0,
+			cache.ResourceEventHandlerFuncs{
+				AddFunc:    func(obj interface{}) { k.onNodeChange(g.zone, g.indexer) },
+				UpdateFunc: func(oldObj, newObj interface{}) { k.onNodeChange(g.zone, g.indexer) },
+				DeleteFunc: func(obj interface{}) { k.onNodeChange(g.zone, g.indexer) },
+			},
+			cache.Indexers{},
+		)
+	}
+
+	if k.configMapName != "" {
+		k.setWatchConfigMap(ctx)
+	}
+}
+
+// setWatchConfigMap starts an informer on the configured overlay ConfigMap,
+// rebuilding k.overlay from its data on every add/update/delete.
+func (k *KubeNodes) setWatchConfigMap(ctx context.Context) {
+	selector := fields.OneTermEqualSelector("metadata.name", k.configMapName).String()
+
+	_, k.configMapController = cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(o v1.ListOptions) (runtime.Object, error) {
+				o.FieldSelector = selector
+				return k.client.CoreV1().ConfigMaps(k.configMapNamespace).List(ctx, o)
+			},
+			WatchFunc: func(o v1.ListOptions) (watch.Interface, error) {
+				o.FieldSelector = selector
+				return k.client.CoreV1().ConfigMaps(k.configMapNamespace).Watch(ctx, o)
+			},
+		},
+		&core.ConfigMap{},
+		0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { k.onConfigMapChange(obj) },
+			UpdateFunc: func(oldObj, newObj interface{}) { k.onConfigMapChange(newObj) },
+			DeleteFunc: func(obj interface{}) { k.setOverlay(nil); atomic.AddUint32(&k.serial, 1) },
+		},
+	)
+}
+
+// onConfigMapChange parses obj's data as zone-file fragments and replaces k.overlay.
+func (k *KubeNodes) onConfigMapChange(obj interface{}) {
+	cm, ok := obj.(*core.ConfigMap)
+	if !ok {
+		log.Warningf("unexpected %T from ConfigMap informer", obj)
+		return
+	}
+
+	overlay := map[string][]dns.RR{}
+	for key, fragment := range cm.Data {
+		zp := dns.NewZoneParser(strings.NewReader(fragment), k.Zones[0], "")
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			name := strings.ToLower(rr.Header().Name)
+			overlay[name] = append(overlay[name], rr)
+		}
+		if err := zp.Err(); err != nil {
+			log.Warningf("configmap %s/%s key %q: %s", k.configMapNamespace, k.configMapName, key, err)
+		}
+	}
+
+	k.setOverlay(overlay)
+	atomic.AddUint32(&k.serial, 1)
 }
 
 func startWatch(k *KubeNodes, config *dnsserver.Config) func() error {
@@ -139,6 +313,17 @@ func startWatch(k *KubeNodes, config *dnsserver.Config) func() error {
 
 		// start the informer
 		go k.controller.Run(k.stopCh)
+		go func() {
+			start := time.Now()
+			cache.WaitForCacheSync(k.stopCh, k.controller.HasSynced)
+			informerSyncDuration.Observe(time.Since(start).Seconds())
+		}()
+		for _, g := range k.groups {
+			go g.controller.Run(k.stopCh)
+		}
+		if k.configMapController != nil {
+			go k.configMapController.Run(k.stopCh)
+		}
 		return nil
 	}
 }